@@ -0,0 +1,212 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"app/db"
+	"app/slg"
+	"app/tools"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	queWriteWait  = 10 * time.Second
+	quePongWait   = 30 * time.Second
+	quePingPeriod = (quePongWait * 9) / 10
+)
+
+var queUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+type QueEvent struct {
+	Type string `json:"type"`
+	Msg  *Msg   `json:"msg,omitempty"`
+	Msgs []*Msg `json:"msgs,omitempty"`
+}
+
+type queHub struct {
+	mu   sync.Mutex
+	subs map[int]map[chan *QueEvent]struct{}
+}
+
+var globalQueHub = &queHub{subs: map[int]map[chan *QueEvent]struct{}{}}
+
+func (h *queHub) subscribe(userId int) chan *QueEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan *QueEvent, 16)
+
+	if h.subs[userId] == nil {
+		h.subs[userId] = map[chan *QueEvent]struct{}{}
+	}
+	h.subs[userId][ch] = struct{}{}
+
+	return ch
+}
+
+func (h *queHub) unsubscribe(userId int, ch chan *QueEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.subs[userId], ch)
+	if len(h.subs[userId]) == 0 {
+		delete(h.subs, userId)
+	}
+
+	close(ch)
+}
+
+func (h *queHub) publish(userId int, event *QueEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs[userId] {
+		select {
+		case ch <- event:
+		default:
+			// subscriber isn't keeping up, drop the frame rather than block publishers
+		}
+	}
+}
+
+func PublishQueDeleted(userId int, msgID int) {
+	globalQueHub.publish(userId, &QueEvent{Type: "deleted", Msg: &Msg{ID: msgID}})
+}
+
+func (api *API) StreamQue(w http.ResponseWriter, r *http.Request) {
+	var userData *db.UserData
+
+	if cookie, err := r.Cookie("session_id"); err != nil || len(cookie.Value) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("unauthorized"))
+
+		return
+	} else if userData, err = db.GetUserDataBySessionId(cookie.Value); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("user data not found"))
+
+		return
+	}
+
+	ctx := slg.WithSlog(r.Context(), slog.With("user", userData.UserLoginData.UserName))
+
+	conn, err := queUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slg.GetSlog(ctx).Error("failed to upgrade que stream", "err", err)
+
+		return
+	}
+	defer conn.Close()
+
+	msgs, err := db.GetAllQueueMessages(userData.UserLoginData.UserId, tools.Wait.String())
+	if err != nil {
+		slg.GetSlog(ctx).Error("couldn't get messages from queue", "err", err)
+
+		return
+	}
+
+	snapshot := &QueEvent{Type: "snapshot"}
+	for _, msg := range msgs {
+		snapshot.Msgs = append(snapshot.Msgs, &Msg{
+			ID: msg.ID,
+
+			UserName:       msg.UserName,
+			Message:        msg.Message,
+			CustomRewardID: msg.CustomRewardID,
+
+			State: msg.State,
+
+			Updated: msg.Updated,
+		})
+	}
+
+	conn.SetReadDeadline(time.Now().Add(quePongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(quePongWait))
+		return nil
+	})
+
+	if err := conn.WriteJSON(snapshot); err != nil {
+		slg.GetSlog(ctx).Error("failed to write que snapshot", "err", err)
+
+		return
+	}
+
+	events := globalQueHub.subscribe(userData.UserLoginData.UserId)
+	defer globalQueHub.unsubscribe(userData.UserLoginData.UserId, events)
+
+	deletes := make(chan int)
+	go readQueCommands(ctx, conn, deletes)
+
+	ticker := time.NewTicker(quePingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			conn.SetWriteDeadline(time.Now().Add(queWriteWait))
+			if err := conn.WriteJSON(event); err != nil {
+				slg.GetSlog(ctx).Error("failed to write que event", "err", err)
+
+				return
+			}
+		case msgID, ok := <-deletes:
+			if !ok {
+				return
+			}
+
+			if err := db.UpdateState(msgID, tools.Deleted.String()); err != nil {
+				slg.GetSlog(ctx).Error("failed to update message state", "err", err)
+
+				continue
+			}
+
+			PublishQueDeleted(userData.UserLoginData.UserId, msgID)
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(queWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func readQueCommands(ctx context.Context, conn *websocket.Conn, deletes chan<- int) {
+	defer close(deletes)
+
+	for {
+		var cmd struct {
+			Action string `json:"action"`
+			MsgID  int    `json:"msg_id"`
+		}
+
+		if err := conn.ReadJSON(&cmd); err != nil {
+			return
+		}
+
+		if cmd.Action != "delete" {
+			continue
+		}
+
+		select {
+		case deletes <- cmd.MsgID:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
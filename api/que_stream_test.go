@@ -0,0 +1,59 @@
+package api
+
+import "testing"
+
+func TestQueHubPublishFansOutToAllSubscribers(t *testing.T) {
+	h := &queHub{subs: map[int]map[chan *QueEvent]struct{}{}}
+
+	a := h.subscribe(1)
+	b := h.subscribe(1)
+	defer h.unsubscribe(1, a)
+	defer h.unsubscribe(1, b)
+
+	event := &QueEvent{Type: "deleted", Msg: &Msg{ID: 42}}
+	h.publish(1, event)
+
+	for _, ch := range []chan *QueEvent{a, b} {
+		select {
+		case got := <-ch:
+			if got != event {
+				t.Fatalf("subscriber received %v, want %v", got, event)
+			}
+		default:
+			t.Fatal("expected the event to be delivered to every subscriber")
+		}
+	}
+}
+
+func TestQueHubPublishIsPerUser(t *testing.T) {
+	h := &queHub{subs: map[int]map[chan *QueEvent]struct{}{}}
+
+	ch := h.subscribe(1)
+	defer h.unsubscribe(1, ch)
+
+	h.publish(2, &QueEvent{Type: "deleted", Msg: &Msg{ID: 1}})
+
+	select {
+	case got := <-ch:
+		t.Fatalf("subscriber for user 1 should not receive user 2's event, got %v", got)
+	default:
+	}
+}
+
+func TestQueHubUnsubscribeClosesChannelAndStopsDelivery(t *testing.T) {
+	h := &queHub{subs: map[int]map[chan *QueEvent]struct{}{}}
+
+	ch := h.subscribe(1)
+	h.unsubscribe(1, ch)
+
+	if _, open := <-ch; open {
+		t.Fatal("unsubscribe should close the subscriber's channel")
+	}
+
+	if _, ok := h.subs[1]; ok {
+		t.Fatal("unsubscribing the last subscriber should drop the user's entry entirely")
+	}
+
+	// publishing after everyone has unsubscribed must not panic or re-deliver
+	h.publish(1, &QueEvent{Type: "deleted", Msg: &Msg{ID: 1}})
+}
@@ -125,5 +125,7 @@ func (api *API) DeleteMsgFromQue(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	PublishQueDeleted(userData.UserLoginData.UserId, int(msgIdInt))
+
 	w.Write([]byte("success"))
 }
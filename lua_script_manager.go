@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"app/db"
+	"app/slg"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// ScriptManager owns the long-lived Lua state for a user's processor run
+// and hot-reloads LuaScript against it when db.Settings changes, so
+// script-built globals survive a save in the UI.
+type ScriptManager struct {
+	luaState *lua.LState
+	luaCfg   *LuaConfig
+	user     string
+
+	stateMu sync.Mutex
+	state   map[string]any
+
+	execMu     sync.Mutex
+	runCtx     context.Context
+	execCtx    context.Context
+	execCancel context.CancelFunc
+}
+
+func NewScriptManager(luaState *lua.LState, luaCfg *LuaConfig, user string, savedState map[string]any) *ScriptManager {
+	if savedState == nil {
+		savedState = map[string]any{}
+	}
+
+	return &ScriptManager{
+		luaState: luaState,
+		luaCfg:   luaCfg,
+		user:     user,
+		state:    savedState,
+	}
+}
+
+func (m *ScriptManager) RegisterStateFuncs() {
+	m.luaState.SetGlobal("save_state", m.luaState.NewFunction(func(l *lua.LState) int {
+		key := l.CheckString(1)
+
+		converted, ok := luaValueToPersistable(l.Get(2))
+		if !ok {
+			l.RaiseError("save_state: unsupported value for key %q, only numbers, strings, bools and flat tables are persisted", key)
+			return 0
+		}
+
+		m.stateMu.Lock()
+		m.state[key] = converted
+		m.stateMu.Unlock()
+
+		return 0
+	}))
+
+	m.luaState.SetGlobal("load_state", m.luaState.NewFunction(func(l *lua.LState) int {
+		key := l.CheckString(1)
+
+		m.stateMu.Lock()
+		value, ok := m.state[key]
+		m.stateMu.Unlock()
+
+		if !ok {
+			l.Push(lua.LNil)
+			return 1
+		}
+
+		l.Push(persistableToLuaValue(l, value))
+		return 1
+	}))
+}
+
+// ResetExecDeadline re-arms MaxScriptExecTime. Called after each blocking
+// binding (get_next_event/ai/tts) returns, so the limit bounds CPU-bound
+// execution between yield points rather than the whole connection.
+func (m *ScriptManager) ResetExecDeadline() {
+	m.execMu.Lock()
+	defer m.execMu.Unlock()
+
+	if m.luaCfg.MaxScriptExecTime <= 0 || m.runCtx == nil {
+		return
+	}
+
+	if m.execCancel != nil {
+		m.execCancel()
+	}
+
+	m.execCtx, m.execCancel = context.WithTimeout(m.runCtx, m.luaCfg.MaxScriptExecTime)
+	m.luaState.SetContext(m.execCtx)
+}
+
+func (m *ScriptManager) execDeadlineExceeded() bool {
+	m.execMu.Lock()
+	defer m.execMu.Unlock()
+
+	return m.execCtx != nil && m.execCtx.Err() == context.DeadlineExceeded
+}
+
+// Ctx returns the context for the in-flight script run, cancelled on
+// hot-reload or MaxScriptExecTime. Native bindings that can block
+// (get_next_event/ai/tts) must select/pass on this instead of Process's
+// long-lived ctx, or a reload can't interrupt them mid-call.
+func (m *ScriptManager) Ctx() context.Context {
+	m.execMu.Lock()
+	defer m.execMu.Unlock()
+
+	if m.execCtx != nil {
+		return m.execCtx
+	}
+
+	return m.runCtx
+}
+
+func (m *ScriptManager) Persist() error {
+	m.stateMu.Lock()
+	state := make(map[string]any, len(m.state))
+	for k, v := range m.state {
+		state[k] = v
+	}
+	m.stateMu.Unlock()
+
+	return db.SaveScriptState(m.user, state)
+}
+
+// Run blocks until the script returns, ctx is done, or updates reports a
+// new LuaScript version, in which case it cancels only the in-flight
+// DoString call and re-executes the new script against the same
+// m.luaState so previously declared globals aren't lost.
+func (m *ScriptManager) Run(ctx context.Context, updates <-chan struct{}, settings *db.Settings) error {
+	script := settings.LuaScript
+
+	for {
+		runCtx, runCancel := context.WithCancel(ctx)
+
+		m.execMu.Lock()
+		m.runCtx = runCtx
+		m.execMu.Unlock()
+
+		m.luaState.SetContext(runCtx)
+		m.ResetExecDeadline()
+
+		stop := func() {
+			runCancel()
+
+			m.execMu.Lock()
+			if m.execCancel != nil {
+				m.execCancel()
+			}
+			m.execMu.Unlock()
+		}
+
+		done := make(chan error, 1)
+		go func(script string) {
+			done <- m.luaState.DoString(script)
+		}(script)
+
+		reloaded := false
+		for !reloaded {
+			select {
+			case err := <-done:
+				if err != nil && m.execDeadlineExceeded() {
+					slg.GetSlog(ctx).Error("script killed: exceeded max exec time", "user", m.user, "max_exec_time", m.luaCfg.MaxScriptExecTime)
+				}
+
+				stop()
+
+				return err
+			case <-updates:
+				newSettings, err := db.GetDbSettings(m.user)
+				if err != nil {
+					slg.GetSlog(ctx).Error("failed to refetch settings for hot-reload", "user", m.user, "err", err)
+					continue
+				}
+
+				if newSettings.LuaScript == script {
+					continue
+				}
+
+				slg.GetSlog(ctx).Info("lua script updated, hot-reloading", "user", m.user)
+
+				stop()
+				<-done
+
+				script = newSettings.LuaScript
+				reloaded = true
+			case <-ctx.Done():
+				stop()
+				<-done
+
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// luaValueToPersistable reports false for anything but numbers, strings,
+// bools, and flat tables of those (functions, userdata, nested tables).
+func luaValueToPersistable(value lua.LValue) (any, bool) {
+	switch v := value.(type) {
+	case lua.LBool:
+		return bool(v), true
+	case lua.LNumber:
+		return float64(v), true
+	case lua.LString:
+		return string(v), true
+	case *lua.LTable:
+		flat := map[string]any{}
+
+		ok := true
+		v.ForEach(func(key, val lua.LValue) {
+			keyStr, isStr := key.(lua.LString)
+			if !isStr {
+				ok = false
+				return
+			}
+
+			if _, nested := val.(*lua.LTable); nested {
+				ok = false
+				return
+			}
+
+			converted, convOk := luaValueToPersistable(val)
+			if !convOk {
+				ok = false
+				return
+			}
+
+			flat[string(keyStr)] = converted
+		})
+
+		if !ok {
+			return nil, false
+		}
+
+		return flat, true
+	default:
+		return nil, false
+	}
+}
+
+// persistableToLuaValue is the inverse of luaValueToPersistable.
+func persistableToLuaValue(l *lua.LState, value any) lua.LValue {
+	switch v := value.(type) {
+	case bool:
+		return lua.LBool(v)
+	case float64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case map[string]any:
+		table := l.NewTable()
+		for k, val := range v {
+			table.RawSetString(k, persistableToLuaValue(l, val))
+		}
+
+		return table
+	default:
+		return lua.LNil
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"app/db"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestScriptManagerResetExecDeadlineArmsTimeout(t *testing.T) {
+	l := lua.NewState()
+	defer l.Close()
+
+	sm := NewScriptManager(l, &LuaConfig{MaxScriptExecTime: 20 * time.Millisecond}, "user", nil)
+	sm.runCtx = context.Background()
+
+	sm.ResetExecDeadline()
+
+	select {
+	case <-sm.Ctx().Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Ctx() did not become done once MaxScriptExecTime elapsed")
+	}
+
+	if !sm.execDeadlineExceeded() {
+		t.Fatal("expected execDeadlineExceeded to report true after the deadline fires")
+	}
+}
+
+func TestScriptManagerCtxFallsBackToRunCtxWithoutDeadline(t *testing.T) {
+	l := lua.NewState()
+	defer l.Close()
+
+	sm := NewScriptManager(l, &LuaConfig{}, "user", nil)
+	sm.runCtx = context.Background()
+
+	sm.ResetExecDeadline()
+
+	if sm.Ctx() != sm.runCtx {
+		t.Fatal("Ctx() should return runCtx when MaxScriptExecTime is unconfigured")
+	}
+}
+
+func TestScriptManagerRunStopsPromptlyOnContextCancel(t *testing.T) {
+	l := lua.NewState()
+	defer l.Close()
+
+	sm := NewScriptManager(l, &LuaConfig{}, "user", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := make(chan struct{})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sm.Run(ctx, updates, &db.Settings{LuaScript: "while true do end"})
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Run() returned %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return promptly after ctx was cancelled")
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"app/db"
+	"app/twitch"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// chatEventGetters backs the ChatEvent userdata's __index, exposing fields
+// of the underlying *twitch.Message that scripts want to read as
+// `evt.field` rather than parsing three bare return values.
+var chatEventGetters = map[string]func(l *lua.LState, msg *twitch.Message) lua.LValue{
+	"user_name":        func(l *lua.LState, msg *twitch.Message) lua.LValue { return lua.LString(msg.UserName) },
+	"message":          func(l *lua.LState, msg *twitch.Message) lua.LValue { return lua.LString(msg.Message) },
+	"custom_reward_id": func(l *lua.LState, msg *twitch.Message) lua.LValue { return lua.LString(msg.CustomRewardID) },
+	"badges":           func(l *lua.LState, msg *twitch.Message) lua.LValue { return stringsToTable(l, msg.Badges) },
+	"emotes":           func(l *lua.LState, msg *twitch.Message) lua.LValue { return stringsToTable(l, msg.Emotes) },
+	"timestamp":        func(l *lua.LState, msg *twitch.Message) lua.LValue { return lua.LNumber(msg.Timestamp.Unix()) },
+}
+
+// chatEventMethods backs the ChatEvent userdata's __index, exposing
+// moderation/role checks as `evt:method()` calls.
+var chatEventMethods = map[string]func(l *lua.LState, msg *twitch.Message) int{
+	"is_mod": func(l *lua.LState, msg *twitch.Message) int {
+		l.Push(lua.LBool(msg.IsMod))
+		return 1
+	},
+	"is_subscriber": func(l *lua.LState, msg *twitch.Message) int {
+		l.Push(lua.LBool(msg.IsSubscriber))
+		return 1
+	},
+	"is_vip": func(l *lua.LState, msg *twitch.Message) int {
+		l.Push(lua.LBool(msg.IsVIP))
+		return 1
+	},
+}
+
+func registerChatEventType(luaState *lua.LState) {
+	mt := luaState.NewTypeMetatable(luaChatEventTypeName)
+	luaState.SetField(mt, "__index", luaState.NewFunction(chatEventIndex))
+}
+
+func newChatEvent(luaState *lua.LState, msg *twitch.Message) *lua.LUserData {
+	ud := luaState.NewUserData()
+	ud.Value = msg
+	luaState.SetMetatable(ud, luaState.GetTypeMetatable(luaChatEventTypeName))
+
+	return ud
+}
+
+func checkChatEvent(l *lua.LState) *twitch.Message {
+	ud := l.CheckUserData(1)
+
+	msg, ok := ud.Value.(*twitch.Message)
+	if !ok {
+		l.ArgError(1, luaChatEventTypeName+" expected")
+		return nil
+	}
+
+	return msg
+}
+
+func chatEventIndex(l *lua.LState) int {
+	msg := checkChatEvent(l)
+	key := l.CheckString(2)
+
+	if getter, ok := chatEventGetters[key]; ok {
+		l.Push(getter(l, msg))
+		return 1
+	}
+
+	if method, ok := chatEventMethods[key]; ok {
+		l.Push(l.NewFunction(func(l *lua.LState) int {
+			return method(l, checkChatEvent(l))
+		}))
+		return 1
+	}
+
+	return 0
+}
+
+const luaChatEventTypeName = "ChatEvent"
+
+// aiResultGetters backs the AIResult userdata's __index. Only text is
+// exposed until app/ai.Client.Ask returns token/model/finish-reason
+// metadata for the other fields to carry.
+var aiResultGetters = map[string]func(l *lua.LState, res *luaAIResult) lua.LValue{
+	"text": func(l *lua.LState, res *luaAIResult) lua.LValue { return lua.LString(res.Text) },
+}
+
+// luaAIResult is the Go-side payload behind the AIResult userdata
+// returned by ai().
+type luaAIResult struct {
+	Text string
+}
+
+func registerAIResultType(luaState *lua.LState) {
+	mt := luaState.NewTypeMetatable(luaAIResultTypeName)
+	luaState.SetField(mt, "__index", luaState.NewFunction(aiResultIndex))
+}
+
+func newAIResult(luaState *lua.LState, res *luaAIResult) *lua.LUserData {
+	ud := luaState.NewUserData()
+	ud.Value = res
+	luaState.SetMetatable(ud, luaState.GetTypeMetatable(luaAIResultTypeName))
+
+	return ud
+}
+
+func checkAIResult(l *lua.LState) *luaAIResult {
+	ud := l.CheckUserData(1)
+
+	res, ok := ud.Value.(*luaAIResult)
+	if !ok {
+		l.ArgError(1, luaAIResultTypeName+" expected")
+		return nil
+	}
+
+	return res
+}
+
+func aiResultIndex(l *lua.LState) int {
+	res := checkAIResult(l)
+	key := l.CheckString(2)
+
+	if getter, ok := aiResultGetters[key]; ok {
+		l.Push(getter(l, res))
+		return 1
+	}
+
+	return 0
+}
+
+const luaAIResultTypeName = "AIResult"
+
+// viewerGetters backs the Viewer userdata's __index, exposing a looked-up
+// viewer's fields as `viewer.field`.
+var viewerGetters = map[string]func(l *lua.LState, viewer *db.Viewer) lua.LValue{
+	"name":          func(l *lua.LState, viewer *db.Viewer) lua.LValue { return lua.LString(viewer.Name) },
+	"is_mod":        func(l *lua.LState, viewer *db.Viewer) lua.LValue { return lua.LBool(viewer.IsMod) },
+	"is_subscriber": func(l *lua.LState, viewer *db.Viewer) lua.LValue { return lua.LBool(viewer.IsSubscriber) },
+	"is_vip":        func(l *lua.LState, viewer *db.Viewer) lua.LValue { return lua.LBool(viewer.IsVIP) },
+}
+
+func registerViewerType(luaState *lua.LState) {
+	mt := luaState.NewTypeMetatable(luaViewerTypeName)
+	luaState.SetField(mt, "__index", luaState.NewFunction(viewerIndex))
+}
+
+func newViewer(luaState *lua.LState, viewer *db.Viewer) *lua.LUserData {
+	ud := luaState.NewUserData()
+	ud.Value = viewer
+	luaState.SetMetatable(ud, luaState.GetTypeMetatable(luaViewerTypeName))
+
+	return ud
+}
+
+func checkViewer(l *lua.LState) *db.Viewer {
+	ud := l.CheckUserData(1)
+
+	viewer, ok := ud.Value.(*db.Viewer)
+	if !ok {
+		l.ArgError(1, luaViewerTypeName+" expected")
+		return nil
+	}
+
+	return viewer
+}
+
+func viewerIndex(l *lua.LState) int {
+	viewer := checkViewer(l)
+	key := l.CheckString(2)
+
+	if getter, ok := viewerGetters[key]; ok {
+		l.Push(getter(l, viewer))
+		return 1
+	}
+
+	return 0
+}
+
+const luaViewerTypeName = "Viewer"
+
+func stringsToTable(l *lua.LState, values []string) *lua.LTable {
+	table := l.NewTable()
+	for _, value := range values {
+		table.Append(lua.LString(value))
+	}
+
+	return table
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+
+	"app/db"
+	"app/twitch"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestChatEventIndexGettersAndMethods(t *testing.T) {
+	l := lua.NewState()
+	defer l.Close()
+
+	registerChatEventType(l)
+
+	msg := &twitch.Message{
+		UserName: "forsen",
+		Message:  "hello chat",
+		IsMod:    true,
+		Badges:   []string{"broadcaster"},
+	}
+
+	ud := newChatEvent(l, msg)
+
+	if got := l.GetField(ud, "message"); got.String() != "hello chat" {
+		t.Fatalf("message getter = %q, want %q", got.String(), "hello chat")
+	}
+
+	isMod, ok := l.GetField(ud, "is_mod").(*lua.LFunction)
+	if !ok {
+		t.Fatal("is_mod should be exposed as a callable method")
+	}
+
+	if err := l.CallByParam(lua.P{Fn: isMod, NRet: 1, Protect: true}, ud); err != nil {
+		t.Fatalf("calling evt:is_mod() failed: %v", err)
+	}
+
+	if ret := l.Get(-1); ret != lua.LTrue {
+		t.Fatalf("evt:is_mod() = %v, want true", ret)
+	}
+	l.Pop(1)
+
+	if got := l.GetField(ud, "unknown_field"); got != lua.LNil {
+		t.Fatalf("unknown field should resolve to nil, got %v", got)
+	}
+}
+
+func TestAIResultIndexOnlyExposesText(t *testing.T) {
+	l := lua.NewState()
+	defer l.Close()
+
+	registerAIResultType(l)
+
+	ud := newAIResult(l, &luaAIResult{Text: "response text"})
+
+	if got := l.GetField(ud, "text"); got.String() != "response text" {
+		t.Fatalf("text getter = %q, want %q", got.String(), "response text")
+	}
+
+	if got := l.GetField(ud, "model"); got != lua.LNil {
+		t.Fatalf("model should not be exposed, got %v", got)
+	}
+}
+
+func TestViewerIndexGetters(t *testing.T) {
+	l := lua.NewState()
+	defer l.Close()
+
+	registerViewerType(l)
+
+	ud := newViewer(l, &db.Viewer{Name: "forsen", IsMod: true, IsVIP: false})
+
+	if got := l.GetField(ud, "name"); got.String() != "forsen" {
+		t.Fatalf("name getter = %q, want %q", got.String(), "forsen")
+	}
+
+	if got := l.GetField(ud, "is_mod"); got != lua.LTrue {
+		t.Fatalf("is_mod getter = %v, want true", got)
+	}
+
+	if got := l.GetField(ud, "is_vip"); got != lua.LFalse {
+		t.Fatalf("is_vip getter = %v, want false", got)
+	}
+}
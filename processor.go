@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"runtime/debug"
 	"time"
 
@@ -13,12 +14,19 @@ import (
 	"app/tts"
 	"app/twitch"
 
+	"github.com/cjoudrey/gluahttp"
+	"github.com/kohkimakimoto/gluayaml"
+	luajson "github.com/layeh/gopher-json"
 	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gluare"
 )
 
 type LuaConfig struct {
 	MaxScriptExecTime time.Duration  `yaml:"max_script_exec_time"`
 	MaxFuncCalls      map[string]int `yaml:"max_func_calls"`
+
+	EnabledModules []string `yaml:"enabled_modules"`
+	HTTPAllowlist  []string `yaml:"http_allowlist"`
 }
 
 type Processor struct {
@@ -47,20 +55,14 @@ func (p *Processor) Process(ctx context.Context, updates chan struct{}, eventWri
 		}
 	}()
 
-	go func() {
-		<-updates
-		slg.GetSlog(ctx).Info("processor signal recieved")
-		cancel()
-	}()
-
 	settings, err := db.GetDbSettings(user)
 	if err != nil {
 		slg.GetSlog(ctx).Info("settings not found, defaulting")
 		settings = &db.Settings{
 			LuaScript: `
 while true do
-	user, msg, reward_id = get_next_event()
-	tts(msg)
+	evt = get_next_event()
+	tts(evt.message)
 end
 			`,
 		}
@@ -75,20 +77,61 @@ end
 
 	twitchChatCh := twitch.MessagesFetcher(ctx, user)
 
+	registerChatEventType(luaState)
+	registerAIResultType(luaState)
+	registerViewerType(luaState)
+
+	savedState, err := db.LoadScriptState(user)
+	if err != nil {
+		slg.GetSlog(ctx).Info("no saved script state found, starting fresh", "user", user, "err", err)
+	}
+
+	scriptManager := NewScriptManager(luaState, p.luaCfg, user, savedState)
+	scriptManager.RegisterStateFuncs()
+
+	defer func() {
+		if err := scriptManager.Persist(); err != nil {
+			slg.GetSlog(ctx).Error("failed to persist script state", "user", user, "err", err)
+		}
+	}()
+
+	funcCalls := map[string]int{}
+
+	checkBudget := func(l *lua.LState, name string) bool {
+		if !budgetExceeded(funcCalls, p.luaCfg.MaxFuncCalls, name) {
+			return true
+		}
+
+		limit := p.luaCfg.MaxFuncCalls[name]
+		slg.GetSlog(ctx).Error("script killed: exceeded call budget", "user", user, "func", name, "limit", limit)
+		l.RaiseError("script killed: exceeded %d %s() calls", limit, name)
+
+		return false
+	}
+
 	luaState.SetGlobal("ai", luaState.NewFunction(func(l *lua.LState) int {
+		if !checkBudget(l, "ai") {
+			return 0
+		}
+
 		request := l.Get(1).String()
 
-		aiResponse, err := p.ai.Ask(ctx, 0, request)
+		aiResponse, err := p.ai.Ask(scriptManager.Ctx(), 0, request)
+		scriptManager.ResetExecDeadline()
 		if err != nil {
 			l.Push(lua.LString("ai request error: " + err.Error()))
 			return 1
 		}
 
-		l.Push(lua.LString(aiResponse))
+		l.Push(newAIResult(l, &luaAIResult{Text: aiResponse}))
 		return 1
 	}))
 
 	luaState.SetGlobal("text", luaState.NewFunction(func(l *lua.LState) int {
+		if !checkBudget(l, "text") {
+			return 0
+		}
+
 		request := l.Get(1).String()
 
 		eventWriter(&conns.DataEvent{
@@ -100,9 +143,14 @@ end
 	}))
 
 	luaState.SetGlobal("tts", luaState.NewFunction(func(l *lua.LState) int {
+		if !checkBudget(l, "tts") {
+			return 0
+		}
+
 		request := l.Get(1).String()
 
-		ttsResponse, err := p.tts.TTS(ctx, request, nil)
+		ttsResponse, err := p.tts.TTS(scriptManager.Ctx(), request, nil)
+		scriptManager.ResetExecDeadline()
 		if err != nil {
 			l.Push(lua.LString("tts request error: " + err.Error()))
 			return 1
@@ -117,21 +165,54 @@ end
 	}))
 
 	luaState.SetGlobal("get_next_event", luaState.NewFunction(func(l *lua.LState) int {
+		if !checkBudget(l, "get_next_event") {
+			return 0
+		}
+
 		select {
 		case msg := <-twitchChatCh:
 			slg.GetSlog(ctx).Info("pushing", "msg", msg)
-			l.Push(lua.LString(msg.UserName))
-			l.Push(lua.LString(msg.Message))
-			l.Push(lua.LString(msg.CustomRewardID))
-		case <-ctx.Done():
-			luaState.Close()
+
+			scriptManager.ResetExecDeadline()
+
+			// each new event starts a fresh turn, so per-event call
+			// budgets (ai/tts/text) reset here
+			for name := range funcCalls {
+				if name != "get_next_event" {
+					funcCalls[name] = 0
+				}
+			}
+
+			l.Push(newChatEvent(l, msg))
+		case <-scriptManager.Ctx().Done():
+			// a reload/exec-deadline cancel must leave luaState alive for
+			// the next run; only close it on real connection teardown.
+			if ctx.Err() != nil {
+				luaState.Close()
+			}
 			return 0
 		}
 
-		return 3
+		return 1
 	}))
 
-	if err := luaState.DoString(settings.LuaScript); err != nil {
+	luaState.SetGlobal("get_viewer", luaState.NewFunction(func(l *lua.LState) int {
+		name := l.CheckString(1)
+
+		viewer, err := db.GetViewer(user, name)
+		if err != nil {
+			l.Push(lua.LNil)
+			l.Push(lua.LString("viewer lookup error: " + err.Error()))
+			return 2
+		}
+
+		l.Push(newViewer(l, viewer))
+		return 1
+	}))
+
+	preloadModules(luaState, p.luaCfg)
+
+	if err := scriptManager.Run(ctx, updates, settings); err != nil {
 		return fmt.Errorf("lua execution err: %w", err)
 	}
 
@@ -139,3 +220,58 @@ end
 
 	return nil
 }
+
+func preloadModules(luaState *lua.LState, luaCfg *LuaConfig) {
+	for _, module := range luaCfg.EnabledModules {
+		switch module {
+		case "base":
+			lua.OpenBase(luaState)
+		case "string":
+			lua.OpenString(luaState)
+		case "table":
+			lua.OpenTable(luaState)
+		case "math":
+			lua.OpenMath(luaState)
+		case "json":
+			luajson.Preload(luaState)
+		case "yaml":
+			luaState.PreloadModule("yaml", gluayaml.Loader)
+		case "re":
+			luaState.PreloadModule("re", gluare.Loader)
+		case "http":
+			luaState.PreloadModule("http", gluahttp.NewHttpModule(&http.Client{
+				Transport: &allowlistTransport{allowlist: luaCfg.HTTPAllowlist},
+			}).Loader)
+		}
+	}
+}
+
+// budgetExceeded increments calls[name] and reports whether it has now
+// exceeded limits[name]. A name with no configured limit is never exceeded
+// and its count is not tracked.
+func budgetExceeded(calls, limits map[string]int, name string) bool {
+	limit, ok := limits[name]
+	if !ok {
+		return false
+	}
+
+	calls[name]++
+	return calls[name] > limit
+}
+
+// allowlistTransport rejects requests to hosts outside the configured
+// allowlist, gating the "http" module behind LuaConfig.HTTPAllowlist.
+// The same list applies to every user; there is no per-user allowlist.
+type allowlistTransport struct {
+	allowlist []string
+}
+
+func (t *allowlistTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for _, host := range t.allowlist {
+		if req.URL.Hostname() == host {
+			return http.DefaultTransport.RoundTrip(req)
+		}
+	}
+
+	return nil, fmt.Errorf("host %q is not in the http allowlist", req.URL.Hostname())
+}
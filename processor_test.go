@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestAllowlistTransportRejectsUnlistedHost(t *testing.T) {
+	transport := &allowlistTransport{allowlist: []string{"api.example.com"}}
+
+	req := &http.Request{URL: &url.URL{Scheme: "https", Host: "evil.com"}}
+
+	if _, err := transport.RoundTrip(req); err == nil {
+		t.Fatal("expected RoundTrip to reject a host outside the allowlist")
+	}
+}
+
+func TestAllowlistTransportEmptyAllowlistRejectsEverything(t *testing.T) {
+	transport := &allowlistTransport{}
+
+	req := &http.Request{URL: &url.URL{Scheme: "https", Host: "api.example.com"}}
+
+	if _, err := transport.RoundTrip(req); err == nil {
+		t.Fatal("expected RoundTrip to reject with an empty allowlist")
+	}
+}
+
+func TestBudgetExceeded(t *testing.T) {
+	calls := map[string]int{}
+	limits := map[string]int{"ai": 2}
+
+	if budgetExceeded(calls, limits, "ai") {
+		t.Fatal("1st call should be within the budget")
+	}
+	if budgetExceeded(calls, limits, "ai") {
+		t.Fatal("2nd call should be within the budget")
+	}
+	if !budgetExceeded(calls, limits, "ai") {
+		t.Fatal("3rd call should exceed the budget")
+	}
+}
+
+func TestBudgetExceededNoLimitConfigured(t *testing.T) {
+	calls := map[string]int{}
+
+	for i := 0; i < 100; i++ {
+		if budgetExceeded(calls, map[string]int{}, "tts") {
+			t.Fatal("a name with no configured limit should never be exceeded")
+		}
+	}
+}